@@ -0,0 +1,38 @@
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+// Package auth provides convenience constructors for the ssh.AuthMethod
+// values go-scp's Client needs to authenticate with a remote host.
+package auth
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSHAgent connects to the running ssh-agent (via the socket named by
+// $SSH_AUTH_SOCK on Unix, or the openssh-ssh-agent named pipe on Windows)
+// and returns an ssh.AuthMethod backed by the keys it offers.
+func SSHAgent() (ssh.AuthMethod, error) {
+	conn, err := dialAgent()
+	if err != nil {
+		return nil, fmt.Errorf("error dialing ssh-agent: %w", err)
+	}
+
+	return authMethodFromConn(conn), nil
+}
+
+// authMethodFromConn wraps an already-established connection to an
+// ssh-agent (real or fake) into an ssh.AuthMethod. Split out from SSHAgent
+// so it can be exercised against a fake agent in tests without touching
+// $SSH_AUTH_SOCK.
+func authMethodFromConn(conn net.Conn) ssh.AuthMethod {
+	ag := agent.NewClient(conn)
+	return ssh.PublicKeysCallback(ag.Signers)
+}
@@ -0,0 +1,67 @@
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startFakeAgent serves an in-memory ssh-agent, holding key, over one end of
+// a net.Pipe and returns the other end for a client to dial.
+func startFakeAgent(t *testing.T, key ed25519.PrivateKey) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("failed to add key to fake agent: %v", err)
+	}
+
+	go agent.ServeAgent(keyring, server)
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestAuthMethodFromConn(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	conn := startFakeAgent(t, priv)
+
+	if authMethod := authMethodFromConn(conn); authMethod == nil {
+		t.Fatal("authMethodFromConn() returned nil")
+	}
+
+	// Confirm a fake agent actually offers the key it is seeded with, by
+	// starting a second fake agent holding the same key and querying it
+	// through agent.NewClient the way authMethodFromConn does internally.
+	signers, err := agent.NewClient(startFakeAgent(t, priv)).Signers()
+	if err != nil {
+		t.Fatalf("Signers() returned an error: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("Signers() returned %d signers, want 1", len(signers))
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to convert test key to ssh.PublicKey: %v", err)
+	}
+	if string(signers[0].PublicKey().Marshal()) != string(sshPub.Marshal()) {
+		t.Fatalf("Signers()[0] public key does not match the seeded key")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+package auth
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// dialAgent connects to the ssh-agent listening on the Unix socket named by
+// $SSH_AUTH_SOCK.
+func dialAgent() (net.Conn, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+	return net.Dial("unix", sock)
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+package auth
+
+import (
+	"net"
+	"os"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// windowsAgentPipe is the named pipe OpenSSH for Windows' ssh-agent service
+// listens on.
+const windowsAgentPipe = `\\.\pipe\openssh-ssh-agent`
+
+// dialAgent connects to the ssh-agent named pipe. $SSH_AUTH_SOCK is honored
+// first for parity with WSL/MSYS setups that still export a Unix socket
+// path.
+func dialAgent() (net.Conn, error) {
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		return net.Dial("unix", sock)
+	}
+	return winio.DialPipe(windowsAgentPipe, nil)
+}
@@ -9,9 +9,12 @@ package scp
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ResponseType = uint8
@@ -25,8 +28,10 @@ const (
 type ProtocolType = rune
 
 const (
-	Chmod ProtocolType = 'C'
-	Time  ProtocolType = 'T'
+	Chmod          ProtocolType = 'C'
+	Time           ProtocolType = 'T'
+	StartDirectory ProtocolType = 'D'
+	EndDirectory   ProtocolType = 'E'
 )
 
 // Response represent a response from the SCP command.
@@ -48,24 +53,43 @@ type Response struct {
 }
 
 // ParseResponse reads from the given reader (assuming it is the output of the remote) and parses it into a Response structure.
-func ParseResponse(reader io.Reader) (Response, error) {
-	buffer := make([]uint8, 1)
-	_, err := reader.Read(buffer)
+//
+// reader must be the same *bufio.Reader for every call made against a given
+// connection. A 'C'/'T'/'D' header is read via ReadString, which may buffer
+// bytes past the trailing newline (e.g. the start of the file content that
+// follows); wrapping a fresh bufio.Reader around the raw stream on each call
+// would silently discard that read-ahead along with whatever it buffered.
+// Reusing the same *bufio.Reader keeps that data available to whichever read
+// comes next, whether that's another ParseResponse call or a content read
+// pulling straight from reader.
+func ParseResponse(reader *bufio.Reader) (Response, error) {
+	responseType, err := reader.ReadByte()
 	if err != nil {
 		return Response{}, err
 	}
 
-	responseType := buffer[0]
-	runeResponseType := rune(buffer[0])
+	runeResponseType := rune(responseType)
 	message := ""
-	if responseType > 0 && (runeResponseType == Chmod || runeResponseType == Time) {
-		bufferedReader := bufio.NewReader(reader)
-		message, err = bufferedReader.ReadString('\n')
+	isFramedType := runeResponseType == Chmod || runeResponseType == Time || runeResponseType == StartDirectory || runeResponseType == EndDirectory || responseType == Warning || responseType == Error
+	if responseType > 0 && isFramedType {
+		message, err = reader.ReadString('\n')
 		if err != nil {
 			return Response{}, err
 		}
 	}
 
+	// 'E' only ever carries its terminating newline, never a payload, so its
+	// message is reported as empty even though the newline above was consumed.
+	if runeResponseType == EndDirectory {
+		return Response{responseType, "", runeResponseType}, nil
+	}
+
+	// Warning/Error are framed by Type, not ProtocolType, so their message is
+	// kept but the protocol type stays the default.
+	if responseType == Warning || responseType == Error {
+		return Response{responseType, message, ' '}, nil
+	}
+
 	if len(message) > 0 {
 		return Response{responseType, message, runeResponseType}, nil
 	}
@@ -99,8 +123,20 @@ func (r *Response) IsTime() bool {
 	return r.ProtocolType == Time
 }
 
+// IsStartDirectory returns true when the remote sent a 'D' message, marking
+// the beginning of a directory when `-r` recursion is in play.
+func (r *Response) IsStartDirectory() bool {
+	return r.ProtocolType == StartDirectory
+}
+
+// IsEndDirectory returns true when the remote sent an 'E' message, closing
+// the directory most recently opened by a 'D' message.
+func (r *Response) IsEndDirectory() bool {
+	return r.ProtocolType == EndDirectory
+}
+
 func (r *Response) NoStandardProtocolType() bool {
-	return !(r.ProtocolType == Chmod || r.ProtocolType == Time)
+	return !(r.ProtocolType == Chmod || r.ProtocolType == Time || r.ProtocolType == StartDirectory || r.ProtocolType == EndDirectory)
 }
 
 // GetMessage returns the message the remote sent back.
@@ -114,7 +150,9 @@ type FileInfos struct {
 	Permissions string
 	Size        int64
 	Atime       int64
+	AtimeUsec   int64
 	Mtime       int64
+	MtimeUsec   int64
 }
 
 func (fileInfos *FileInfos) Update(new *FileInfos) {
@@ -133,9 +171,37 @@ func (fileInfos *FileInfos) Update(new *FileInfos) {
 	if new.Atime != 0 {
 		fileInfos.Atime = new.Atime
 	}
+	if new.AtimeUsec != 0 {
+		fileInfos.AtimeUsec = new.AtimeUsec
+	}
 	if new.Mtime != 0 {
 		fileInfos.Mtime = new.Mtime
 	}
+	if new.MtimeUsec != 0 {
+		fileInfos.MtimeUsec = new.MtimeUsec
+	}
+}
+
+// Mode parses Permissions (an octal string such as "0644", as carried by a
+// 'C' or 'D' frame) into an os.FileMode.
+func (fileInfos *FileInfos) Mode() (os.FileMode, error) {
+	perm, err := strconv.ParseUint(fileInfos.Permissions, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse permissions %q: %w", fileInfos.Permissions, err)
+	}
+	return os.FileMode(perm), nil
+}
+
+// AccessTime returns the Atime/AtimeUsec carried by a preceding 'T' frame as
+// a time.Time.
+func (fileInfos *FileInfos) AccessTime() time.Time {
+	return time.Unix(fileInfos.Atime, fileInfos.AtimeUsec*1000)
+}
+
+// ModTime returns the Mtime/MtimeUsec carried by a preceding 'T' frame as a
+// time.Time.
+func (fileInfos *FileInfos) ModTime() time.Time {
+	return time.Unix(fileInfos.Mtime, fileInfos.MtimeUsec*1000)
 }
 
 func (r *Response) ParseFileInfos() (*FileInfos, error) {
@@ -158,26 +224,48 @@ func (r *Response) ParseFileInfos() (*FileInfos, error) {
 	}, nil
 }
 
+// ParseDirInfos parses a 'D' start-of-directory message into a FileInfos.
+// A directory header has the same "<permissions> <size> <name>" shape as a
+// 'C' message, except size is always 0, so it reuses ParseFileInfos.
+func (r *Response) ParseDirInfos() (*FileInfos, error) {
+	return r.ParseFileInfos()
+}
+
+// ParseFileTime parses a 'T' frame of the form
+// "T<mtime> <mtime_usec> <atime> <atime_usec>\n" where each field is a
+// variable-width decimal integer (scp sends seconds since the epoch, so
+// these grow past 10 digits after the year 2286, and usecs range 0-7
+// digits).
 func (r *Response) ParseFileTime() (*FileInfos, error) {
 	message := strings.ReplaceAll(r.Message, "\n", "")
 	parts := strings.Split(message, " ")
-	if len(parts) < 3 {
+	if len(parts) < 4 {
 		return nil, errors.New("unable to parse Time protocol")
 	}
 
-	aTime, err := strconv.Atoi(string(parts[0][1:10]))
+	mtime, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "T"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Mtime component of message: %w", err)
+	}
+	mtimeUsec, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		return nil, errors.New("unable to parse ATime component of message")
+		return nil, fmt.Errorf("unable to parse MtimeUsec component of message: %w", err)
 	}
-	mTime, err := strconv.Atoi(string(parts[2][0:10]))
+	atime, err := strconv.ParseInt(parts[2], 10, 64)
 	if err != nil {
-		return nil, errors.New("unable to parse MTime component of message")
+		return nil, fmt.Errorf("unable to parse Atime component of message: %w", err)
+	}
+	atimeUsec, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse AtimeUsec component of message: %w", err)
 	}
 
 	return &FileInfos{
-		Message: r.Message,
-		Atime:   int64(aTime),
-		Mtime:   int64(mTime),
+		Message:   r.Message,
+		Mtime:     mtime,
+		MtimeUsec: mtimeUsec,
+		Atime:     atime,
+		AtimeUsec: atimeUsec,
 	}, nil
 }
 
@@ -194,3 +282,11 @@ func Ack(writer io.Writer) error {
 	}
 	return nil
 }
+
+// WriteError writes a `\x02`-framed error message to the remote, the
+// counterpart to Ack for reporting a failure. A ParseResponse call on the
+// other end of writer will surface it as a Response with IsError() true.
+func WriteError(writer io.Writer, msg string) error {
+	_, err := fmt.Fprintf(writer, "%c%s\n", Error, msg)
+	return err
+}
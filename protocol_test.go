@@ -0,0 +1,79 @@
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+package scp
+
+import "testing"
+
+func TestParseFileTime(t *testing.T) {
+	cases := []struct {
+		name    string
+		message string
+		want    FileInfos
+		wantErr bool
+	}{
+		{
+			name:    "minimum",
+			message: "T0 0 0 0\n",
+			want:    FileInfos{Mtime: 0, MtimeUsec: 0, Atime: 0, AtimeUsec: 0},
+		},
+		{
+			name:    "maximum int64",
+			message: "T9223372036854775807 9999999 9223372036854775807 9999999\n",
+			want: FileInfos{
+				Mtime:     9223372036854775807,
+				MtimeUsec: 9999999,
+				Atime:     9223372036854775807,
+				AtimeUsec: 9999999,
+			},
+		},
+		{
+			name:    "typical",
+			message: "T1627849200 123456 1627849100 654321\n",
+			want: FileInfos{
+				Mtime:     1627849200,
+				MtimeUsec: 123456,
+				Atime:     1627849100,
+				AtimeUsec: 654321,
+			},
+		},
+		{
+			name:    "too few fields",
+			message: "T1627849200 123456 1627849100\n",
+			wantErr: true,
+		},
+		{
+			name:    "malformed mtime",
+			message: "Tabc 0 0 0\n",
+			wantErr: true,
+		},
+		{
+			name:    "malformed atime_usec",
+			message: "T0 0 0 xyz\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Response{Message: tc.message, ProtocolType: Time}
+			got, err := r.ParseFileTime()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseFileTime(%q) = %+v, want error", tc.message, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFileTime(%q) returned unexpected error: %v", tc.message, err)
+			}
+			if got.Mtime != tc.want.Mtime || got.MtimeUsec != tc.want.MtimeUsec ||
+				got.Atime != tc.want.Atime || got.AtimeUsec != tc.want.AtimeUsec {
+				t.Fatalf("ParseFileTime(%q) = %+v, want %+v", tc.message, got, tc.want)
+			}
+		})
+	}
+}
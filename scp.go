@@ -0,0 +1,382 @@
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+package scp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/jpdoyon/go-scp/auth"
+)
+
+// Client wraps an SSH connection and drives the SCP protocol over it.
+type Client struct {
+	Host         string
+	ClientConfig *ssh.ClientConfig
+	Conn         *ssh.Client
+	Timeout      time.Duration
+	RemoteBinary string
+}
+
+// NewClient creates a Client for host that will use config to authenticate
+// once Connect is called.
+func NewClient(host string, config *ssh.ClientConfig, timeout time.Duration) Client {
+	return Client{
+		Host:         host,
+		ClientConfig: config,
+		Timeout:      timeout,
+		RemoteBinary: "scp",
+	}
+}
+
+// NewClientWithAgent creates a Client for host, authenticating as user with
+// the keys offered by a running ssh-agent (see auth.SSHAgent), once Connect
+// is called.
+func NewClientWithAgent(host string, user string, hostKey ssh.HostKeyCallback) (Client, error) {
+	authMethod, err := auth.SSHAgent()
+	if err != nil {
+		return Client{}, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{authMethod},
+		HostKeyCallback: hostKey,
+	}
+
+	return NewClient(host, config, 0), nil
+}
+
+// Connect dials the remote host, readying the Client for Copy* calls.
+func (c *Client) Connect() error {
+	conn, err := ssh.Dial("tcp", c.Host, c.ClientConfig)
+	if err != nil {
+		return fmt.Errorf("error dialing %s: %w", c.Host, err)
+	}
+
+	c.Conn = conn
+	return nil
+}
+
+// Close tears down the underlying SSH connection.
+func (c *Client) Close() {
+	if c.Conn != nil {
+		c.Conn.Close()
+	}
+}
+
+// newSession opens a session against the remote, starting cmd once its
+// stdin/stdout pipes are ready. It returns in (the stdin pipe, so
+// producer-side callers can close it to signal EOF once they are done
+// sending frames), r, a single *bufio.Reader wrapping stdout that must be
+// reused for every read against this session (see ParseResponse for why),
+// and stop, which callers must defer alongside session.Close() to release
+// the goroutine watching ctx. While the session is open, cancelling ctx
+// closes it, unblocking any pending read/write with an error.
+func (c *Client) newSession(ctx context.Context, cmd string) (session *ssh.Session, in io.WriteCloser, r *bufio.Reader, stop func(), err error) {
+	session, err = c.Conn.NewSession()
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error creating session: %w", err)
+	}
+
+	in, err = session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, nil, nil, nil, err
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, nil, nil, nil, err
+	}
+
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		return nil, nil, nil, nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	return session, in, bufio.NewReader(out), func() { close(done) }, nil
+}
+
+// CopyToRemote copies the local file at localPath to remotePath on the
+// remote host by running `scp -t`.
+func (c *Client) CopyToRemote(ctx context.Context, localPath string, remotePath string) error {
+	session, in, r, stop, err := c.newSession(ctx, fmt.Sprintf("%s -t %s", c.RemoteBinary, remotePath))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	defer stop()
+
+	if err := awaitAck(r); err != nil {
+		return err
+	}
+
+	if err := sendFile(NewSource(r, in), localPath); err != nil {
+		return err
+	}
+
+	// signal EOF so the remote `scp -t`, which otherwise waits for another
+	// header, knows no more files are coming.
+	if err := in.Close(); err != nil {
+		return err
+	}
+
+	return session.Wait()
+}
+
+// CopyFromRemote copies remotePath from the remote host into the local file
+// at localPath by running `scp -f`.
+func (c *Client) CopyFromRemote(ctx context.Context, remotePath string, localPath string) error {
+	session, in, r, stop, err := c.newSession(ctx, fmt.Sprintf("%s -f %s", c.RemoteBinary, remotePath))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	defer stop()
+
+	if err := Ack(in); err != nil {
+		return err
+	}
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := NewSink(r, in).ReceiveFile(file); err != nil {
+		return err
+	}
+
+	return session.Wait()
+}
+
+// PreserveOptions controls how CopyFromRemotePreserve applies the remote's
+// reported permissions and timestamps once a transfer completes.
+type PreserveOptions struct {
+	// File, when non-nil, has the remote-reported permissions and
+	// access/modification times applied to it via Chmod/Chtimes.
+	File *os.File
+}
+
+// CopyFromRemotePreserve copies remotePath from the remote host into out by
+// running `scp -p -f`, mirroring scp's `-p` flag. On success it returns the
+// FileInfos parsed from the remote's 'T' and 'C' frames, and, when
+// opts.File is set, applies the reported permissions and times to it so
+// callers don't have to do it themselves.
+func (c *Client) CopyFromRemotePreserve(ctx context.Context, out io.Writer, remotePath string, opts PreserveOptions) (*FileInfos, error) {
+	session, in, r, stop, err := c.newSession(ctx, fmt.Sprintf("%s -p -f %s", c.RemoteBinary, remotePath))
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	defer stop()
+
+	if err := Ack(in); err != nil {
+		return nil, err
+	}
+
+	infos, err := NewSink(r, in).ReceiveFile(out)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := session.Wait(); err != nil {
+		return nil, err
+	}
+
+	if opts.File != nil {
+		mode, err := infos.Mode()
+		if err != nil {
+			return infos, err
+		}
+		if err := opts.File.Chmod(mode); err != nil {
+			return infos, err
+		}
+		if err := os.Chtimes(opts.File.Name(), infos.AccessTime(), infos.ModTime()); err != nil {
+			return infos, err
+		}
+	}
+
+	return infos, nil
+}
+
+// CopyDirToRemote recursively copies the local directory rooted at localDir
+// to remotePath on the remote host, emitting a nested 'D'...'E' frame for
+// every subdirectory and a 'C' frame for every regular file it contains.
+func (c *Client) CopyDirToRemote(ctx context.Context, localDir string, remotePath string) error {
+	session, in, r, stop, err := c.newSession(ctx, fmt.Sprintf("%s -rt %s", c.RemoteBinary, remotePath))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	defer stop()
+
+	if err := awaitAck(r); err != nil {
+		return err
+	}
+
+	if err := sendDir(NewSource(r, in), localDir); err != nil {
+		return err
+	}
+
+	// signal EOF so the remote `scp -rt`, which otherwise waits for another
+	// header, knows no more files are coming.
+	if err := in.Close(); err != nil {
+		return err
+	}
+
+	return session.Wait()
+}
+
+// CopyDirFromRemote recursively copies remotePath from the remote host into
+// localDir, creating subdirectories as 'D'...'E' frames are encountered and
+// files as 'C' frames are encountered.
+func (c *Client) CopyDirFromRemote(ctx context.Context, remotePath string, localDir string) error {
+	session, in, r, stop, err := c.newSession(ctx, fmt.Sprintf("%s -rf %s", c.RemoteBinary, remotePath))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	defer stop()
+
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return err
+	}
+
+	if err := Ack(in); err != nil {
+		return err
+	}
+
+	if err := receiveDir(NewSink(r, in), localDir); err != nil {
+		return err
+	}
+
+	return session.Wait()
+}
+
+// sendFile emits a single 'C' frame (header, content, terminator) for the
+// file at path via source.
+func sendFile(source *Source, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return source.SendFile(fmt.Sprintf("%04o", info.Mode().Perm()), info.Size(), filepath.Base(path), file)
+}
+
+// sendDir emits a 'D'...'E' frame pair for dir via source, recursing into
+// subdirectories and emitting a 'C' frame for every file in between.
+func sendDir(source *Source, dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := source.SendDirStart(fmt.Sprintf("%04o", info.Mode().Perm()), filepath.Base(dir)); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if err := sendDir(source, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := sendFile(source, path); err != nil {
+			return err
+		}
+	}
+
+	return source.SendDirEnd()
+}
+
+// receiveDir pulls headers from sink until it reports io.EOF (the 'E'
+// message that closes dir), creating subdirectories and files as it
+// encounters their 'D' and 'C' frames.
+func receiveDir(sink *Sink, dir string) error {
+	for {
+		infos, isDir, err := sink.ReceiveHeader()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if isDir {
+			subdir := filepath.Join(dir, infos.Filename)
+			perm, err := strconv.ParseUint(infos.Permissions, 8, 32)
+			if err != nil {
+				return fmt.Errorf("unable to parse directory permissions %q: %w", infos.Permissions, err)
+			}
+			if err := os.MkdirAll(subdir, os.FileMode(perm)); err != nil {
+				return err
+			}
+			if err := receiveDir(sink, subdir); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := os.Create(filepath.Join(dir, infos.Filename))
+		if err != nil {
+			return err
+		}
+		err = sink.ReceiveContent(file, infos.Size)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// awaitAck reads a single response from r and turns a warning or error
+// response into a Go error.
+func awaitAck(r *bufio.Reader) error {
+	response, err := ParseResponse(r)
+	if err != nil {
+		return err
+	}
+	if response.IsFailure() {
+		return &RemoteError{Message: response.GetMessage(), Warning: response.IsWarning()}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+package scp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RemoteError wraps a `\x01`/`\x02`-framed warning or error message sent by
+// the remote end of an SCP conversation. Warning is true when the message
+// came from a `\x01` frame, in which case the connection is still usable.
+type RemoteError struct {
+	Message string
+	Warning bool
+}
+
+func (e *RemoteError) Error() string {
+	if e.Warning {
+		return fmt.Sprintf("scp warning: %s", e.Message)
+	}
+	return fmt.Sprintf("scp error: %s", e.Message)
+}
+
+// Sink drives the "downloading" half of the SCP protocol: for every file it
+// reads an optional 'T' frame followed by a 'C' (or 'D') frame from r,
+// ACKing each one onto w, then streams exactly the announced number of
+// bytes of content into a caller-supplied io.Writer, consumes the trailing
+// null terminator and ACKs once more.
+type Sink struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// NewSink creates a Sink that reads frames from r and ACKs onto w. r must
+// be the single *bufio.Reader used for every read against this connection
+// (see ParseResponse for why).
+func NewSink(r *bufio.Reader, w io.Writer) *Sink {
+	return &Sink{r: r, w: w}
+}
+
+// ReceiveHeader reads responses from the remote until it has a full 'C' or
+// 'D' header, merging in the Atime/Mtime/AtimeUsec/MtimeUsec carried by any
+// preceding 'T' frame. It ACKs every 'T', 'C', 'D' and 'E' frame it
+// consumes; a warning or error frame is returned as a *RemoteError without
+// an ACK. isDir reports whether the header was a 'D' (start of directory)
+// rather than a 'C' (file) frame. An 'E' frame is reported as io.EOF so
+// callers walking a directory know to stop.
+func (s *Sink) ReceiveHeader() (infos *FileInfos, isDir bool, err error) {
+	var pending FileInfos
+	for {
+		response, err := ParseResponse(s.r)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if response.IsFailure() {
+			return nil, false, &RemoteError{Message: response.GetMessage(), Warning: response.IsWarning()}
+		}
+
+		if response.IsEndDirectory() {
+			if err := Ack(s.w); err != nil {
+				return nil, false, err
+			}
+			return nil, false, io.EOF
+		}
+
+		if response.IsTime() {
+			t, err := response.ParseFileTime()
+			if err != nil {
+				return nil, false, err
+			}
+			pending.Update(t)
+			if err := Ack(s.w); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		parsed, err := response.ParseFileInfos()
+		if err != nil {
+			return nil, false, err
+		}
+		pending.Update(parsed)
+		if err := Ack(s.w); err != nil {
+			return nil, false, err
+		}
+		return &pending, response.IsStartDirectory(), nil
+	}
+}
+
+// ReceiveContent streams exactly size bytes from the remote into w via a
+// LimitReader, so it never reads past this file's content into the next
+// frame, then consumes the trailing null terminator and ACKs.
+func (s *Sink) ReceiveContent(w io.Writer, size int64) error {
+	if _, err := io.Copy(w, io.LimitReader(s.r, size)); err != nil {
+		return err
+	}
+
+	terminator, err := s.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if terminator != 0 {
+		return fmt.Errorf("expected a null terminator after file content, got %q", terminator)
+	}
+
+	return Ack(s.w)
+}
+
+// ReceiveFile reads a single file's header and content, returning its
+// FileInfos. It is a convenience wrapper over ReceiveHeader and
+// ReceiveContent for callers that don't need to handle directories.
+func (s *Sink) ReceiveFile(w io.Writer) (*FileInfos, error) {
+	infos, isDir, err := s.ReceiveHeader()
+	if err != nil {
+		return nil, err
+	}
+	if isDir {
+		return nil, errors.New("scp: expected a file but remote sent a directory header")
+	}
+
+	if err := s.ReceiveContent(w, infos.Size); err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+// Source drives the "uploading" half of the SCP protocol: for every file it
+// writes a 'C' header to w, awaits the remote's ACK on r, streams the
+// content followed by the null terminator, and awaits the closing ACK.
+type Source struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// NewSource creates a Source that writes frames to w and awaits ACKs from
+// r. As with NewSink, r must be the single *bufio.Reader used for every
+// read against this connection (see ParseResponse for why).
+func NewSource(r *bufio.Reader, w io.Writer) *Source {
+	return &Source{r: r, w: w}
+}
+
+// SendFile writes a 'C' header describing permissions (as a 4-digit octal
+// string, e.g. "0644"), size and name, then copies exactly size bytes from
+// content as the file's content followed by the null terminator, awaiting
+// the remote's ACK after the header and after the terminator.
+func (s *Source) SendFile(permissions string, size int64, name string, content io.Reader) error {
+	if _, err := fmt.Fprintf(s.w, "C%s %d %s\n", permissions, size, name); err != nil {
+		return err
+	}
+	if err := awaitAck(s.r); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(s.w, content, size); err != nil {
+		return err
+	}
+	// the null terminator that follows the raw content is written the same
+	// way as an Ack, since both are a single zero byte.
+	if err := Ack(s.w); err != nil {
+		return err
+	}
+
+	return awaitAck(s.r)
+}
+
+// SendDirStart writes a 'D' header opening a directory named name with the
+// given permissions.
+func (s *Source) SendDirStart(permissions string, name string) error {
+	if _, err := fmt.Fprintf(s.w, "D%s 0 %s\n", permissions, name); err != nil {
+		return err
+	}
+	return awaitAck(s.r)
+}
+
+// SendDirEnd writes the 'E' message closing the directory most recently
+// opened by SendDirStart.
+func (s *Source) SendDirEnd() error {
+	if _, err := fmt.Fprint(s.w, "E\n"); err != nil {
+		return err
+	}
+	return awaitAck(s.r)
+}
@@ -0,0 +1,140 @@
+/* Copyright (c) 2021 Bram Vandenbogaerde And Contributors
+ * You may use, distribute or modify this code under the
+ * terms of the Mozilla Public License 2.0, which is distributed
+ * along with the source code.
+ */
+
+package scp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseResponseDoesNotDropReadAhead is a regression test for a bug where
+// ParseResponse wrapped a fresh bufio.Reader around the raw stream on every
+// call: any bytes its single Read() pulled in past a header's trailing
+// newline (such as the start of the file content that follows) were
+// buffered inside that bufio.Reader and lost once it went out of scope.
+// Reusing the same *bufio.Reader across calls must leave that content
+// readable afterwards.
+func TestParseResponseDoesNotDropReadAhead(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("C0644 5 file.txt\nHELLO\x00"))
+
+	response, err := ParseResponse(r)
+	if err != nil {
+		t.Fatalf("ParseResponse() returned an error: %v", err)
+	}
+	if !response.IsChmod() {
+		t.Fatalf("ParseResponse() did not return a Chmod response: %+v", response)
+	}
+
+	remaining, err := r.Peek(6)
+	if err != nil {
+		t.Fatalf("expected the file content to still be buffered, got error: %v", err)
+	}
+	if string(remaining) != "HELLO\x00" {
+		t.Fatalf("remaining buffered bytes = %q, want %q", remaining, "HELLO\x00")
+	}
+}
+
+// TestWriteErrorRoundTripsThroughParseResponse is a regression test for a
+// bug where ParseResponse never read the `\x02<message>\n` body WriteError
+// writes: Warning/Error were excluded from the set of types whose message
+// line gets consumed, so Response.Message came back empty and the
+// unconsumed "<message>\n" desynced whichever ParseResponse call came next.
+func TestWriteErrorRoundTripsThroughParseResponse(t *testing.T) {
+	var wire bytes.Buffer
+	if err := WriteError(&wire, "boom"); err != nil {
+		t.Fatalf("WriteError() returned an error: %v", err)
+	}
+
+	r := bufio.NewReader(&wire)
+	response, err := ParseResponse(r)
+	if err != nil {
+		t.Fatalf("ParseResponse() returned an error: %v", err)
+	}
+	if !response.IsError() {
+		t.Fatalf("ParseResponse() did not return an Error response: %+v", response)
+	}
+	if got, want := response.GetMessage(), "boom\n"; got != want {
+		t.Fatalf("GetMessage() = %q, want %q", got, want)
+	}
+	if r.Buffered() != 0 {
+		t.Fatalf("ParseResponse() left %d bytes unconsumed, want 0", r.Buffered())
+	}
+}
+
+// TestSinkReceiveFile exercises Sink end to end against a fixture that,
+// unlike a real SSH pipe, never happens to return exactly one line per
+// Read: a plain bytes.Buffer. This is the scenario the read-ahead bug above
+// hit immediately.
+func TestSinkReceiveFile(t *testing.T) {
+	var wire bytes.Buffer
+	wire.WriteString("C0644 5 file.txt\n")
+	wire.WriteString("HELLO")
+	wire.WriteByte(0)
+
+	var acks bytes.Buffer
+	sink := NewSink(bufio.NewReader(&wire), &acks)
+
+	var content bytes.Buffer
+	infos, err := sink.ReceiveFile(&content)
+	if err != nil {
+		t.Fatalf("ReceiveFile() returned an error: %v", err)
+	}
+
+	if content.String() != "HELLO" {
+		t.Fatalf("ReceiveFile() wrote content %q, want %q", content.String(), "HELLO")
+	}
+	if infos.Filename != "file.txt" || infos.Size != 5 || infos.Permissions != "0644" {
+		t.Fatalf("ReceiveFile() infos = %+v, want filename=file.txt size=5 permissions=0644", infos)
+	}
+	if acks.Len() != 2 {
+		t.Fatalf("ReceiveFile() wrote %d ACKs, want 2 (header + content)", acks.Len())
+	}
+}
+
+// TestSinkReceiveFilePreservesTimeAndMode is a regression test for
+// CopyFromRemotePreserve's `-p -f` path: a 'T' frame precedes the 'C'
+// header, and its Atime/Mtime must still be merged into the FileInfos
+// returned once content has been read, now that ParseResponse no longer
+// drops read-ahead bytes between the two frames.
+func TestSinkReceiveFilePreservesTimeAndMode(t *testing.T) {
+	var wire bytes.Buffer
+	wire.WriteString("T1700000000 0 1600000000 0\n")
+	wire.WriteString("C0640 5 file.txt\n")
+	wire.WriteString("HELLO")
+	wire.WriteByte(0)
+
+	var acks bytes.Buffer
+	sink := NewSink(bufio.NewReader(&wire), &acks)
+
+	var content bytes.Buffer
+	infos, err := sink.ReceiveFile(&content)
+	if err != nil {
+		t.Fatalf("ReceiveFile() returned an error: %v", err)
+	}
+
+	if content.String() != "HELLO" {
+		t.Fatalf("ReceiveFile() wrote content %q, want %q", content.String(), "HELLO")
+	}
+
+	mode, err := infos.Mode()
+	if err != nil {
+		t.Fatalf("Mode() returned an error: %v", err)
+	}
+	if mode != 0640 {
+		t.Fatalf("Mode() = %o, want %o", mode, 0640)
+	}
+
+	if got, want := infos.ModTime(), time.Unix(1700000000, 0); !got.Equal(want) {
+		t.Fatalf("ModTime() = %v, want %v", got, want)
+	}
+	if got, want := infos.AccessTime(), time.Unix(1600000000, 0); !got.Equal(want) {
+		t.Fatalf("AccessTime() = %v, want %v", got, want)
+	}
+}